@@ -0,0 +1,97 @@
+// Package miner assembles blocks out of the unconfirmed transaction set and
+// searches for a valid proof of work.
+package miner
+
+import (
+	"errors"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/sync"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+var (
+	errNilCS     = errors.New("miner cannot use a nil consensus set")
+	errNilTpool  = errors.New("miner cannot use a nil transaction pool")
+	errNilWallet = errors.New("miner cannot use a nil wallet")
+)
+
+// Miner assembles blocks out of the unconfirmed transaction set for the
+// current consensus tip and searches for a valid proof of work.
+type Miner struct {
+	cs     modules.ConsensusSet
+	tpool  modules.TransactionPool
+	wallet modules.Wallet
+
+	persistDir string
+
+	parent            types.BlockID
+	height            types.BlockHeight
+	target            types.Target
+	earliestTimestamp types.Timestamp
+
+	// transactions is the set of unconfirmed transactions the miner will
+	// include in the next block it assembles.
+	transactions []types.Transaction
+
+	// txnSizeCache remembers the marshaled size of every transaction the
+	// miner has seen, keyed by transaction id, so that re-sorting the
+	// unconfirmed set on every update doesn't require re-marshaling
+	// transactions that haven't changed.
+	txnSizeCache map[types.TransactionID]int
+
+	// maxHighPriorityBytesPerBlock bounds how much of a block's size budget
+	// high-priority transactions (storage proofs, host announcements) may
+	// consume before the fee-sorted queue gets a turn.
+	maxHighPriorityBytesPerBlock int
+
+	mu sync.TryMutex
+}
+
+// New returns an initialized Miner, subscribed to the consensus set and
+// transaction pool.
+func New(cs modules.ConsensusSet, tpool modules.TransactionPool, wallet modules.Wallet, persistDir string) (*Miner, error) {
+	if cs == nil {
+		return nil, errNilCS
+	}
+	if tpool == nil {
+		return nil, errNilTpool
+	}
+	if wallet == nil {
+		return nil, errNilWallet
+	}
+
+	m := &Miner{
+		cs:     cs,
+		tpool:  tpool,
+		wallet: wallet,
+
+		persistDir: persistDir,
+
+		txnSizeCache:                 make(map[types.TransactionID]int),
+		maxHighPriorityBytesPerBlock: int(types.BlockSizeLimit / 2),
+	}
+
+	cs.ConsensusSetSubscribe(m)
+	tpool.TransactionPoolSubscribe(m)
+
+	return m, nil
+}
+
+// FindBlock assembles a block out of the current unconfirmed transaction
+// set and searches for a nonce that satisfies the current target.
+func (m *Miner) FindBlock() (types.Block, error) {
+	lockID := m.mu.Lock()
+	b := types.Block{
+		ParentID:     m.parent,
+		Timestamp:    types.CurrentTimestamp(),
+		Transactions: m.transactions,
+	}
+	target := m.target
+	m.mu.Unlock(lockID)
+
+	for !b.CheckTarget(target) {
+		b.Nonce++
+	}
+	return b, nil
+}
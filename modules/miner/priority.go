@@ -0,0 +1,55 @@
+package miner
+
+import (
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// hostAnnouncementPrefix tags the arbitrary data blobs recognized as host
+// announcements. It must match modules/transactionpool's definition, since
+// both packages need to agree on which transactions count as high-priority.
+var hostAnnouncementPrefix = types.Specifier{'H', 'o', 's', 't', 'A', 'n', 'n', 'o', 'u', 'n', 'c', 'e', 'm', 'e', 'n', 't'}
+
+// hostAnnouncement is the payload of a host announcement; see
+// modules/transactionpool's copy of the same struct for details.
+type hostAnnouncement struct {
+	UnlockHash  types.UnlockHash
+	FreezeIndex uint64
+}
+
+func isHighPriorityHostAnnouncement(t types.Transaction, arbitraryData []byte) bool {
+	if len(arbitraryData) <= len(hostAnnouncementPrefix) {
+		return false
+	}
+	var prefix types.Specifier
+	copy(prefix[:], arbitraryData[:len(hostAnnouncementPrefix)])
+	if prefix != hostAnnouncementPrefix {
+		return false
+	}
+
+	var ha hostAnnouncement
+	if err := encoding.Unmarshal(arbitraryData[len(hostAnnouncementPrefix):], &ha); err != nil {
+		return false
+	}
+	if ha.FreezeIndex >= uint64(len(t.SiacoinOutputs)) {
+		return false
+	}
+	return t.SiacoinOutputs[ha.FreezeIndex].UnlockHash == ha.UnlockHash
+}
+
+// isHighPriority reports whether t should be packed ahead of the fee-sorted
+// queue: it contains a storage proof against a contract whose proof window
+// is currently open, or a well-formed host announcement.
+func (m *Miner) isHighPriority(t types.Transaction) bool {
+	for _, sp := range t.StorageProofs {
+		if m.cs.StorageProofWindowOpen(sp.ParentID) {
+			return true
+		}
+	}
+	for _, arbitraryData := range t.ArbitraryData {
+		if isHighPriorityHostAnnouncement(t, arbitraryData) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,9 @@
 package miner
 
 import (
+	"bytes"
+	"sort"
+
 	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
@@ -35,8 +38,110 @@ func (m *Miner) ReceiveConsensusSetUpdate(cc modules.ConsensusChange) {
 	m.earliestTimestamp = timestamp
 }
 
-// ReceiveUpdatedUnconfirmedTransactions will replace the current unconfirmed
-// set of transactions with the input transactions. This is a part of the
+// txnPackage is a group of unconfirmed transactions that must be included in
+// a block together, because later transactions in the package spend outputs
+// created by earlier ones. Packages let a low-fee parent transaction be
+// pulled into a block by a high-fee child (child-pays-for-parent), since the
+// package as a whole is scored by its aggregate fee per byte.
+type txnPackage struct {
+	txns       []types.Transaction
+	size       int
+	feePerByte types.Currency
+}
+
+// txnSize returns the marshaled size of t, using and populating m.txnSizeCache
+// so that repeated calls across updates don't re-marshal unchanged
+// transactions. The caller must hold m.mu.
+func (m *Miner) txnSize(t types.Transaction) int {
+	id := t.ID()
+	if size, cached := m.txnSizeCache[id]; cached {
+		return size
+	}
+	size := len(encoding.Marshal(t))
+	m.txnSizeCache[id] = size
+	return size
+}
+
+// buildPackages groups the unconfirmed transactions into packages: any
+// transaction that spends an output produced by another unconfirmed
+// transaction is folded into that transaction's package. The caller must
+// hold m.mu.
+func (m *Miner) buildPackages(unconfirmedTransactions []types.Transaction) []*txnPackage {
+	producedBy := make(map[types.SiacoinOutputID]int) // output id -> index of producing txn
+	for i, t := range unconfirmedTransactions {
+		for j := range t.SiacoinOutputs {
+			producedBy[t.SiacoinOutputID(uint64(j))] = i
+		}
+	}
+
+	// Union transactions into their parent's package whenever they spend an
+	// in-pool parent, walking all the way back to the root ancestor.
+	rootOf := make([]int, len(unconfirmedTransactions))
+	for i := range unconfirmedTransactions {
+		rootOf[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		for rootOf[i] != i {
+			rootOf[i] = rootOf[rootOf[i]]
+			i = rootOf[i]
+		}
+		return i
+	}
+	for i, t := range unconfirmedTransactions {
+		for _, input := range t.SiacoinInputs {
+			if parent, exists := producedBy[input.ParentID]; exists {
+				pi, pj := find(parent), find(i)
+				if pi != pj {
+					rootOf[pj] = pi
+				}
+			}
+		}
+	}
+
+	packages := make(map[int]*txnPackage)
+	order := make([]int, 0, len(unconfirmedTransactions))
+	for i, t := range unconfirmedTransactions {
+		root := find(i)
+		pkg, exists := packages[root]
+		if !exists {
+			pkg = &txnPackage{}
+			packages[root] = pkg
+			order = append(order, root)
+		}
+		pkg.txns = append(pkg.txns, t)
+		pkg.size += m.txnSize(t)
+	}
+
+	result := make([]*txnPackage, 0, len(order))
+	for _, root := range order {
+		pkg := packages[root]
+		fees := types.ZeroCurrency
+		for _, t := range pkg.txns {
+			for _, fee := range t.MinerFees {
+				fees = fees.Add(fee)
+			}
+		}
+		if pkg.size > 0 {
+			pkg.feePerByte = fees.Div(types.NewCurrency64(uint64(pkg.size)))
+		}
+		result = append(result, pkg)
+	}
+	return result
+}
+
+// packageHash returns a deterministic tie-breaker for sorting packages with
+// identical fee-per-byte: the id of the package's first transaction.
+func packageHash(pkg *txnPackage) types.TransactionID {
+	return pkg.txns[0].ID()
+}
+
+// ReceiveUpdatedUnconfirmedTransactions assembles a new block transaction
+// set out of the unconfirmed transactions, packing the highest fee-per-byte
+// transactions first instead of taking them in arrival order. Transactions
+// that depend on each other in the pool are grouped into a package and
+// scored by their aggregate fee per byte, so a high-fee child pulls in its
+// low-fee parent (child-pays-for-parent). This is a part of the
 // TransactionPoolSubscriber interface.
 func (m *Miner) ReceiveUpdatedUnconfirmedTransactions(unconfirmedTransactions []types.Transaction, _ modules.ConsensusChange) {
 	lockID := m.mu.Lock()
@@ -44,16 +149,50 @@ func (m *Miner) ReceiveUpdatedUnconfirmedTransactions(unconfirmedTransactions []
 
 	m.transactions = nil
 	remainingSize := int(types.BlockSizeLimit - 5e3)
-	for {
-		if len(unconfirmedTransactions) == 0 {
-			break
+
+	// Trim the size cache down to the current unconfirmed set so it doesn't
+	// grow without bound as transactions confirm or get evicted from the
+	// pool.
+	current := make(map[types.TransactionID]struct{}, len(unconfirmedTransactions))
+	for _, t := range unconfirmedTransactions {
+		current[t.ID()] = struct{}{}
+	}
+	for id := range m.txnSizeCache {
+		if _, exists := current[id]; !exists {
+			delete(m.txnSizeCache, id)
+		}
+	}
+
+	// High-priority transactions (storage proofs, host announcements) are
+	// packed first, up to their own size budget, so that fee-paying junk in
+	// the pool can't crowd them out of the next block.
+	var regular []types.Transaction
+	highPrioritySize := 0
+	for _, t := range unconfirmedTransactions {
+		size := m.txnSize(t)
+		if m.isHighPriority(t) && highPrioritySize+size <= m.maxHighPriorityBytesPerBlock && size <= remainingSize {
+			m.transactions = append(m.transactions, t)
+			highPrioritySize += size
+			remainingSize -= size
+			continue
 		}
-		remainingSize -= len(encoding.Marshal(unconfirmedTransactions[0]))
-		if remainingSize < 0 {
-			break
+		regular = append(regular, t)
+	}
+
+	packages := m.buildPackages(regular)
+	sort.Slice(packages, func(i, j int) bool {
+		cmp := packages[i].feePerByte.Cmp(packages[j].feePerByte)
+		if cmp != 0 {
+			return cmp > 0
 		}
+		return bytes.Compare(packageHash(packages[i])[:], packageHash(packages[j])[:]) < 0
+	})
 
-		m.transactions = append(m.transactions, unconfirmedTransactions[0])
-		unconfirmedTransactions = unconfirmedTransactions[1:]
+	for _, pkg := range packages {
+		if pkg.size > remainingSize {
+			continue
+		}
+		remainingSize -= pkg.size
+		m.transactions = append(m.transactions, pkg.txns...)
 	}
 }
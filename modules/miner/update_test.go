@@ -0,0 +1,103 @@
+package miner
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// hostAnnouncementArbitraryData encodes a well-formed host announcement
+// that freezes coins in outputIndex of the surrounding transaction.
+func hostAnnouncementArbitraryData(unlockHash types.UnlockHash, outputIndex uint64) []byte {
+	ha := hostAnnouncement{UnlockHash: unlockHash, FreezeIndex: outputIndex}
+	return append(hostAnnouncementPrefix[:], encoding.Marshal(ha)...)
+}
+
+// TestReceiveUpdatedUnconfirmedTransactionsFeeOrder checks that the miner
+// packs the highest fee-per-byte transaction first instead of the first one
+// it saw, when both fit in the block.
+func TestReceiveUpdatedUnconfirmedTransactionsFeeOrder(t *testing.T) {
+	m := &Miner{txnSizeCache: make(map[types.TransactionID]int)}
+
+	lowFee := types.Transaction{
+		MinerFees: []types.Currency{types.NewCurrency64(1)},
+		ArbitraryData: [][]byte{
+			make([]byte, 100),
+		},
+	}
+	highFee := types.Transaction{
+		MinerFees: []types.Currency{types.NewCurrency64(1000)},
+	}
+
+	m.ReceiveUpdatedUnconfirmedTransactions([]types.Transaction{lowFee, highFee}, modules.ConsensusChange{})
+
+	if len(m.transactions) != 2 {
+		t.Fatalf("expected both transactions to fit, got %d", len(m.transactions))
+	}
+	if m.transactions[0].ID() != highFee.ID() {
+		t.Fatal("miner did not pack the higher fee-per-byte transaction first")
+	}
+}
+
+// TestReceiveUpdatedUnconfirmedTransactionsHighPriority checks that a
+// high-priority transaction (here, a host announcement) is still packed
+// into the block even when the pool is otherwise full of better-paying
+// junk transactions.
+func TestReceiveUpdatedUnconfirmedTransactionsHighPriority(t *testing.T) {
+	m := &Miner{
+		txnSizeCache:                 make(map[types.TransactionID]int),
+		maxHighPriorityBytesPerBlock: int(types.BlockSizeLimit),
+	}
+
+	dest := types.UnlockConditions{}.UnlockHash()
+	announcement := types.Transaction{
+		SiacoinOutputs: []types.SiacoinOutput{
+			{Value: types.NewCurrency64(1), UnlockHash: dest},
+		},
+		ArbitraryData: [][]byte{hostAnnouncementArbitraryData(dest, 0)},
+	}
+
+	junk := make([]types.Transaction, 0, 100)
+	for i := 0; i < 100; i++ {
+		junk = append(junk, types.Transaction{
+			MinerFees:     []types.Currency{types.NewCurrency64(1e6)},
+			ArbitraryData: [][]byte{make([]byte, int(types.BlockSizeLimit)/50)},
+		})
+	}
+
+	unconfirmed := append([]types.Transaction{announcement}, junk...)
+	m.ReceiveUpdatedUnconfirmedTransactions(unconfirmed, modules.ConsensusChange{})
+
+	found := false
+	for _, txn := range m.transactions {
+		if txn.ID() == announcement.ID() {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("high-priority host announcement was crowded out by fee-paying junk")
+	}
+}
+
+// TestReceiveUpdatedUnconfirmedTransactionsPrunesSizeCache checks that a
+// transaction's entry in the size cache is dropped once it is no longer
+// part of the unconfirmed set, so the cache doesn't grow without bound as
+// the pool churns.
+func TestReceiveUpdatedUnconfirmedTransactionsPrunesSizeCache(t *testing.T) {
+	m := &Miner{txnSizeCache: make(map[types.TransactionID]int)}
+
+	confirmed := types.Transaction{
+		MinerFees: []types.Currency{types.NewCurrency64(1)},
+	}
+	m.ReceiveUpdatedUnconfirmedTransactions([]types.Transaction{confirmed}, modules.ConsensusChange{})
+	if _, cached := m.txnSizeCache[confirmed.ID()]; !cached {
+		t.Fatal("expected transaction to be cached after being seen")
+	}
+
+	m.ReceiveUpdatedUnconfirmedTransactions(nil, modules.ConsensusChange{})
+	if _, cached := m.txnSizeCache[confirmed.ID()]; cached {
+		t.Fatal("confirmed transaction's size cache entry was not pruned")
+	}
+}
@@ -0,0 +1,328 @@
+package transactionpool
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+const (
+	// walFilename is the name of the write-ahead log, stored in the tpool's
+	// persist directory, that records every accepted and removed
+	// transaction so the unconfirmed set survives a restart.
+	walFilename = "transactionpool.log"
+
+	// rebroadcastInterval is how often the rebroadcast worker wakes up to
+	// check whether any unconfirmed transactions need to be re-gossiped.
+	rebroadcastInterval = 10 * time.Minute
+
+	// rebroadcastAfterBlocks is the base backoff, in blocks, before a
+	// transaction is rebroadcast for the first time. Each subsequent
+	// rebroadcast doubles the wait.
+	rebroadcastAfterBlocks = types.BlockHeight(2)
+
+	// rebroadcastTTLBlocks is how long a transaction is allowed to sit
+	// unconfirmed before the tpool gives up on it and drops it from the
+	// pool entirely.
+	rebroadcastTTLBlocks = types.BlockHeight(144)
+
+	// maxRebroadcastBackoffShift caps the exponent used to compute the
+	// rebroadcast backoff, so that rebroadcastAfterBlocks<<attempts can
+	// never overflow into a backoff of zero.
+	maxRebroadcastBackoffShift = 32
+)
+
+// walEntryType distinguishes the two kinds of records appended to the
+// write-ahead log.
+type walEntryType uint8
+
+const (
+	walEntryAccept walEntryType = iota
+	walEntryRemove
+)
+
+// walEntry is a single write-ahead log record: either a transaction that
+// was accepted into the pool, or a tombstone marking one as removed.
+type walEntry struct {
+	Type        walEntryType
+	Seq         uint64
+	Transaction types.Transaction
+}
+
+// txnMeta tracks the bookkeeping the rebroadcast worker needs for a pool
+// transaction.
+type txnMeta struct {
+	heightAdded   types.BlockHeight
+	lastBroadcast types.BlockHeight
+	attempts      uint
+}
+
+// walPath returns the path to the write-ahead log inside the tpool's
+// persist directory.
+func (tp *TransactionPool) walPath() string {
+	return filepath.Join(tp.persistDir, walFilename)
+}
+
+// appendWAL writes entry to the write-ahead log and flushes it to disk. The
+// caller must hold tp.mu.
+func (tp *TransactionPool) appendWAL(entryType walEntryType, t types.Transaction) error {
+	if tp.wal == nil {
+		return nil
+	}
+
+	tp.walSeq++
+	entry := walEntry{Type: entryType, Seq: tp.walSeq, Transaction: t}
+	payload := encoding.Marshal(entry)
+
+	var lengthPrefix [8]byte
+	binary.LittleEndian.PutUint64(lengthPrefix[:], uint64(len(payload)))
+
+	if _, err := tp.wal.Write(lengthPrefix[:]); err != nil {
+		return err
+	}
+	if _, err := tp.wal.Write(payload); err != nil {
+		return err
+	}
+	return tp.wal.Sync()
+}
+
+// logAndAddTransaction records t as accepted in the write-ahead log, then
+// adds it to the in-memory pool. The caller must hold tp.mu.
+func (tp *TransactionPool) logAndAddTransaction(t types.Transaction, highPriority bool) error {
+	if err := tp.appendWAL(walEntryAccept, t); err != nil {
+		return err
+	}
+	tp.addTransactionToPool(t, highPriority)
+	tp.txnMeta[t.ID()] = &txnMeta{heightAdded: tp.cs.Height()}
+	return nil
+}
+
+// logAndRemoveTransaction records t as removed in the write-ahead log, then
+// takes it out of the in-memory pool. The caller must hold tp.mu.
+func (tp *TransactionPool) logAndRemoveTransaction(t types.Transaction) error {
+	if err := tp.appendWAL(walEntryRemove, t); err != nil {
+		return err
+	}
+	tp.removeTransactionFromPool(t)
+	delete(tp.txnMeta, t.ID())
+	return nil
+}
+
+// readWALEntries reads every entry currently in the write-ahead log.
+func readWALEntries(r io.Reader) ([]walEntry, error) {
+	br := bufio.NewReader(r)
+	var entries []walEntry
+	for {
+		var lengthPrefix [8]byte
+		if _, err := io.ReadFull(br, lengthPrefix[:]); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		length := binary.LittleEndian.Uint64(lengthPrefix[:])
+
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(br, payload); err != nil {
+			return nil, err
+		}
+
+		var entry walEntry
+		if err := encoding.Unmarshal(payload, &entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// initWAL opens the write-ahead log, replays it against the current
+// consensus tip to rebuild the unconfirmed set, and then compacts the log
+// so that it only contains the transactions that survived the replay.
+func (tp *TransactionPool) initWAL() error {
+	if tp.persistDir == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile(tp.walPath(), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+
+	entries, err := readWALEntries(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	// pendingSeq records the sequence number of each survivor's accept
+	// entry, so replay can be ordered deterministically instead of by map
+	// iteration order.
+	pending := make(map[types.TransactionID]types.Transaction)
+	pendingSeq := make(map[types.TransactionID]uint64)
+	for _, entry := range entries {
+		if entry.Seq > tp.walSeq {
+			tp.walSeq = entry.Seq
+		}
+		switch entry.Type {
+		case walEntryAccept:
+			pending[entry.Transaction.ID()] = entry.Transaction
+			pendingSeq[entry.Transaction.ID()] = entry.Seq
+		case walEntryRemove:
+			delete(pending, entry.Transaction.ID())
+			delete(pendingSeq, entry.Transaction.ID())
+		}
+	}
+
+	survivors := make([]types.Transaction, 0, len(pending))
+	for _, t := range pending {
+		survivors = append(survivors, t)
+	}
+	sort.Slice(survivors, func(i, j int) bool {
+		return pendingSeq[survivors[i].ID()] < pendingSeq[survivors[j].ID()]
+	})
+
+	for _, t := range survivors {
+		// Drop anything that is no longer valid: double spent, timelocks
+		// that no longer hold, or outputs that have disappeared.
+		if err := tp.validTransaction(t); err != nil {
+			continue
+		}
+		highPriority := tp.isHighPriority(t)
+		// Replay never evicts: which transactions survive a crash-recovery
+		// should depend only on the WAL's deterministic accept order, not
+		// on whether an already-replayed survivor happens to be picked as
+		// an eviction victim.
+		if err := tp.checkPolicy(t, highPriority, false); err != nil {
+			continue
+		}
+		tp.addTransactionToPool(t, highPriority)
+		tp.txnMeta[t.ID()] = &txnMeta{heightAdded: tp.cs.Height()}
+	}
+
+	tp.wal = f
+	return tp.compactWAL()
+}
+
+// compactWAL rewrites the write-ahead log so that it contains exactly one
+// accept entry per transaction currently in the pool, discarding every
+// tombstone and every entry for a transaction that didn't survive replay.
+// The caller must hold tp.mu.
+func (tp *TransactionPool) compactWAL() error {
+	if tp.wal == nil {
+		return nil
+	}
+
+	tmpPath := tp.walPath() + ".compact"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range tp.transactionList {
+		tp.walSeq++
+		entry := walEntry{Type: walEntryAccept, Seq: tp.walSeq, Transaction: t}
+		payload := encoding.Marshal(entry)
+
+		var lengthPrefix [8]byte
+		binary.LittleEndian.PutUint64(lengthPrefix[:], uint64(len(payload)))
+		if _, err := tmp.Write(lengthPrefix[:]); err != nil {
+			tmp.Close()
+			return err
+		}
+		if _, err := tmp.Write(payload); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	tmp.Close()
+
+	tp.wal.Close()
+	if err := os.Rename(tmpPath, tp.walPath()); err != nil {
+		return err
+	}
+
+	tp.wal, err = os.OpenFile(tp.walPath(), os.O_RDWR|os.O_APPEND, 0600)
+	return err
+}
+
+// threadedRebroadcast periodically re-gossips unconfirmed transactions that
+// haven't confirmed in a while, with exponential backoff between attempts,
+// and drops anything that has been unconfirmed for longer than
+// rebroadcastTTLBlocks.
+func (tp *TransactionPool) threadedRebroadcast() {
+	ticker := time.NewTicker(rebroadcastInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-tp.closeChan:
+			return
+		case <-ticker.C:
+		}
+
+		tp.mu.Lock()
+		height := tp.cs.Height()
+		for _, t := range append([]types.Transaction(nil), tp.transactionList...) {
+			meta, exists := tp.txnMeta[t.ID()]
+			if !exists {
+				continue
+			}
+
+			// A reorg can drop the tip below heightAdded/lastBroadcast; treat
+			// that as "not yet due" rather than underflowing into a huge
+			// unsigned age that looks TTL-expired.
+			if height >= meta.heightAdded {
+				age := height - meta.heightAdded
+				if age >= rebroadcastTTLBlocks {
+					tp.logAndRemoveTransaction(t)
+					tp.notifySubscribers()
+					continue
+				}
+			}
+
+			shift := meta.attempts
+			if shift > maxRebroadcastBackoffShift {
+				shift = maxRebroadcastBackoffShift
+			}
+			backoff := rebroadcastAfterBlocks << shift
+			// Until the worker has rebroadcast t once, the backoff is
+			// measured from the height at which t entered the pool.
+			last := meta.lastBroadcast
+			if meta.attempts == 0 {
+				last = meta.heightAdded
+			}
+			if height < last || height-last < backoff {
+				continue
+			}
+
+			tp.gateway.Broadcast("RelayTransaction", t)
+			meta.lastBroadcast = height
+			meta.attempts++
+		}
+		tp.mu.Unlock()
+	}
+}
+
+// Close stops the rebroadcast worker and closes the write-ahead log.
+func (tp *TransactionPool) Close() error {
+	close(tp.closeChan)
+
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	if tp.wal == nil {
+		return nil
+	}
+	return tp.wal.Close()
+}
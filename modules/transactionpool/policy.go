@@ -0,0 +1,387 @@
+package transactionpool
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+const (
+	// policyFilename is the name of the file, stored in the tpool's persist
+	// directory, that holds the current policy in JSON form.
+	policyFilename = "policy.json"
+
+	// persistDirPerm is the permissions used when creating the tpool
+	// persist directory.
+	persistDirPerm = 0700
+)
+
+var (
+	errPoolFull          = errors.New("transaction pool is full and no transaction could be evicted to make room")
+	errTxnTooLarge       = errors.New("transaction is larger than the maximum allowed transaction size")
+	errFeeTooLow         = errors.New("transaction fee per byte is below the minimum enforced by the pool policy")
+	errTooManyFromSender = errors.New("sender has too many transactions already in the pool")
+	errBlockedAddress    = errors.New("transaction spends from or pays to a blocked address")
+)
+
+// Policy describes the set of rules a transaction must satisfy before it is
+// admitted to the unconfirmed transaction set, as well as the limits used to
+// decide what gets evicted when the pool is full. It is the tpool's
+// equivalent of a SimplePolicy plugin: every knob is a plain value that can
+// be loaded from disk, edited, and saved back out.
+type Policy struct {
+	// MaxPoolSizeBytes is the maximum combined encoded size of every
+	// transaction held in the pool. Once the pool reaches this size, the
+	// lowest fee-per-byte transaction (and its in-pool descendants) is
+	// evicted to make room for new, higher-paying transactions. A new
+	// transaction is refused if that one eviction would not free enough room.
+	MaxPoolSizeBytes uint64
+
+	// MaxTransactionSizeBytes is the largest a single transaction is
+	// allowed to be.
+	MaxTransactionSizeBytes uint64
+
+	// MinFeePerByte is the minimum fee, in Hastings, a non-free transaction
+	// must pay for every byte of its encoded size.
+	MinFeePerByte types.Currency
+
+	// MaxFreeTransactionSizeBytes is the largest a transaction paying no
+	// fee at all is allowed to be. A value of zero disallows free
+	// transactions entirely, regardless of size.
+	MaxFreeTransactionSizeBytes uint64
+
+	// MaxTransactionsPerSender caps how many pool transactions may share the
+	// same first-input unlock hash.
+	MaxTransactionsPerSender uint64
+
+	// BlockedUnlockHashes is a set of addresses that may neither send nor
+	// receive coins through the pool.
+	BlockedUnlockHashes map[types.UnlockHash]struct{}
+}
+
+// DefaultPolicy returns the policy used when no config file is present on
+// disk. The values are generous enough not to interfere with ordinary use,
+// while still bounding the resources a pool will consume.
+func DefaultPolicy() Policy {
+	return Policy{
+		MaxPoolSizeBytes:            32e6,
+		MaxTransactionSizeBytes:     512e3,
+		MinFeePerByte:               types.NewCurrency64(1),
+		MaxFreeTransactionSizeBytes: 1e3,
+		MaxTransactionsPerSender:    64,
+		BlockedUnlockHashes:         make(map[types.UnlockHash]struct{}),
+	}
+}
+
+// policyFile mirrors Policy but uses a JSON-friendly representation for the
+// fields that encoding/json cannot marshal directly.
+type policyFile struct {
+	MaxPoolSizeBytes            uint64
+	MaxTransactionSizeBytes     uint64
+	MinFeePerByte               types.Currency
+	MaxFreeTransactionSizeBytes uint64
+	MaxTransactionsPerSender    uint64
+	BlockedUnlockHashes         []types.UnlockHash
+}
+
+func (p Policy) toFile() policyFile {
+	blocked := make([]types.UnlockHash, 0, len(p.BlockedUnlockHashes))
+	for uh := range p.BlockedUnlockHashes {
+		blocked = append(blocked, uh)
+	}
+	return policyFile{
+		MaxPoolSizeBytes:            p.MaxPoolSizeBytes,
+		MaxTransactionSizeBytes:     p.MaxTransactionSizeBytes,
+		MinFeePerByte:               p.MinFeePerByte,
+		MaxFreeTransactionSizeBytes: p.MaxFreeTransactionSizeBytes,
+		MaxTransactionsPerSender:    p.MaxTransactionsPerSender,
+		BlockedUnlockHashes:         blocked,
+	}
+}
+
+func (pf policyFile) toPolicy() Policy {
+	blocked := make(map[types.UnlockHash]struct{})
+	for _, uh := range pf.BlockedUnlockHashes {
+		blocked[uh] = struct{}{}
+	}
+	return Policy{
+		MaxPoolSizeBytes:            pf.MaxPoolSizeBytes,
+		MaxTransactionSizeBytes:     pf.MaxTransactionSizeBytes,
+		MinFeePerByte:               pf.MinFeePerByte,
+		MaxFreeTransactionSizeBytes: pf.MaxFreeTransactionSizeBytes,
+		MaxTransactionsPerSender:    pf.MaxTransactionsPerSender,
+		BlockedUnlockHashes:         blocked,
+	}
+}
+
+// policyFilePath returns the path to the policy config file inside the
+// tpool's persist directory.
+func (tp *TransactionPool) policyFilePath() string {
+	return filepath.Join(tp.persistDir, policyFilename)
+}
+
+// initPersist creates the tpool's persist directory and loads the policy
+// config file, writing out the default policy if none exists yet.
+func (tp *TransactionPool) initPersist() error {
+	if tp.persistDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(tp.persistDir, persistDirPerm); err != nil {
+		return err
+	}
+	return tp.loadPolicy()
+}
+
+// loadPolicy reads the policy config file from disk, creating it with the
+// default policy if it does not yet exist.
+func (tp *TransactionPool) loadPolicy() error {
+	f, err := os.Open(tp.policyFilePath())
+	if os.IsNotExist(err) {
+		return tp.savePolicy()
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var pf policyFile
+	if err := json.NewDecoder(f).Decode(&pf); err != nil {
+		return err
+	}
+	tp.policy = pf.toPolicy()
+	return nil
+}
+
+// savePolicy writes the current policy config file to disk.
+func (tp *TransactionPool) savePolicy() error {
+	if tp.persistDir == "" {
+		return nil
+	}
+	f, err := os.Create(tp.policyFilePath())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "\t")
+	return enc.Encode(tp.policy.toFile())
+}
+
+// SetPolicy replaces the tpool's policy and persists it to disk. It is
+// exported primarily so that tests can exercise specific policy limits
+// without going through the config file.
+func (tp *TransactionPool) SetPolicy(p Policy) error {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	tp.policy = p
+	return tp.savePolicy()
+}
+
+// feePerByte returns the transaction's total miner fee divided by its
+// encoded size.
+func feePerByte(t types.Transaction) (types.Currency, uint64) {
+	size := uint64(len(encoding.Marshal(t)))
+	if size == 0 {
+		return types.ZeroCurrency, 0
+	}
+	fees := types.ZeroCurrency
+	for _, fee := range t.MinerFees {
+		fees = fees.Add(fee)
+	}
+	return fees.Div(types.NewCurrency64(size)), size
+}
+
+// senderUnlockHash returns the unlock hash that is considered to be the
+// transaction's sender: the unlock hash of its first input.
+func senderUnlockHash(t types.Transaction) (types.UnlockHash, bool) {
+	if len(t.SiacoinInputs) == 0 {
+		return types.UnlockHash{}, false
+	}
+	return t.SiacoinInputs[0].UnlockConditions.UnlockHash(), true
+}
+
+// checkBlockedAddresses returns an error if t spends from or pays to any of
+// the policy's blocked addresses.
+func (p Policy) checkBlockedAddresses(t types.Transaction) error {
+	if len(p.BlockedUnlockHashes) == 0 {
+		return nil
+	}
+	for _, input := range t.SiacoinInputs {
+		if _, blocked := p.BlockedUnlockHashes[input.UnlockConditions.UnlockHash()]; blocked {
+			return errBlockedAddress
+		}
+	}
+	for _, output := range t.SiacoinOutputs {
+		if _, blocked := p.BlockedUnlockHashes[output.UnlockHash]; blocked {
+			return errBlockedAddress
+		}
+	}
+	return nil
+}
+
+// sendersInPool counts, for each sender unlock hash currently represented in
+// the pool, how many transactions it has contributed. The caller must hold
+// tp.mu.
+func (tp *TransactionPool) sendersInPool() map[types.UnlockHash]uint64 {
+	counts := make(map[types.UnlockHash]uint64)
+	for _, t := range tp.transactionList {
+		if uh, ok := senderUnlockHash(t); ok {
+			counts[uh]++
+		}
+	}
+	return counts
+}
+
+// poolSizeBytes returns the combined encoded size of every transaction
+// currently in the pool. The caller must hold tp.mu.
+func (tp *TransactionPool) poolSizeBytes() uint64 {
+	var total uint64
+	for _, t := range tp.transactionList {
+		total += uint64(len(encoding.Marshal(t)))
+	}
+	return total
+}
+
+// descendantsOf returns every pool transaction that spends an output
+// created by t, directly or transitively. The caller must hold tp.mu.
+func (tp *TransactionPool) descendantsOf(t types.Transaction) []types.Transaction {
+	produced := make(map[types.SiacoinOutputID]struct{})
+	for i := range t.SiacoinOutputs {
+		produced[t.SiacoinOutputID(uint64(i))] = struct{}{}
+	}
+
+	var descendants []types.Transaction
+	for _, candidate := range tp.transactionList {
+		if candidate.ID() == t.ID() {
+			continue
+		}
+		for _, input := range candidate.SiacoinInputs {
+			if _, spendsParent := produced[input.ParentID]; spendsParent {
+				descendants = append(descendants, candidate)
+				descendants = append(descendants, tp.descendantsOf(candidate)...)
+				break
+			}
+		}
+	}
+	return descendants
+}
+
+// lowestFeeTransaction returns the pool transaction with the lowest fee per
+// byte that is eligible for eviction, along with its fee per byte.
+// High-priority transactions are never eligible. The caller must hold tp.mu.
+func (tp *TransactionPool) lowestFeeTransaction() (types.Transaction, types.Currency, bool) {
+	var lowest *types.Transaction
+	var lowestFeePerByte types.Currency
+	for i, t := range tp.transactionList {
+		if _, highPriority := tp.highPriorityIDs[t.ID()]; highPriority {
+			continue
+		}
+		fpb, _ := feePerByte(t)
+		if lowest == nil || fpb.Cmp(lowestFeePerByte) < 0 {
+			lowest = &tp.transactionList[i]
+			lowestFeePerByte = fpb
+		}
+	}
+	if lowest == nil {
+		return types.Transaction{}, types.ZeroCurrency, false
+	}
+	return *lowest, lowestFeePerByte, true
+}
+
+// evictTransaction removes victim and its pool descendants to make room for
+// a new transaction, logging each removal to the write-ahead log and
+// notifying subscribers of the resulting transaction set. The caller must
+// hold tp.mu.
+func (tp *TransactionPool) evictTransaction(victim types.Transaction) error {
+	if err := tp.logAndRemoveTransaction(victim); err != nil {
+		return err
+	}
+	for _, descendant := range tp.descendantsOf(victim) {
+		if err := tp.logAndRemoveTransaction(descendant); err != nil {
+			return err
+		}
+	}
+	tp.notifySubscribers()
+	return nil
+}
+
+// checkPolicy enforces the tpool's policy against t, evicting the lowest fee
+// per byte transaction to make room if the pool is full and allowEvict is
+// set. High-priority transactions bypass the fee-per-byte minimums. The
+// caller must hold tp.mu.
+func (tp *TransactionPool) checkPolicy(t types.Transaction, highPriority, allowEvict bool) error {
+	p := tp.policy
+
+	if err := p.checkBlockedAddresses(t); err != nil {
+		return err
+	}
+
+	fpb, size := feePerByte(t)
+	if p.MaxTransactionSizeBytes != 0 && size > p.MaxTransactionSizeBytes {
+		return errTxnTooLarge
+	}
+
+	if !highPriority {
+		fees := types.ZeroCurrency
+		for _, fee := range t.MinerFees {
+			fees = fees.Add(fee)
+		}
+		if fees.IsZero() {
+			if size > p.MaxFreeTransactionSizeBytes {
+				return errFeeTooLow
+			}
+		} else if fpb.Cmp(p.MinFeePerByte) < 0 {
+			return errFeeTooLow
+		}
+	}
+
+	if p.MaxTransactionsPerSender != 0 {
+		if uh, ok := senderUnlockHash(t); ok {
+			if tp.sendersInPool()[uh] >= p.MaxTransactionsPerSender {
+				return errTooManyFromSender
+			}
+		}
+	}
+
+	if p.MaxPoolSizeBytes != 0 && tp.poolSizeBytes()+size > p.MaxPoolSizeBytes {
+		if !allowEvict {
+			return errPoolFull
+		}
+
+		// Only evict once it's known that t will actually be admitted:
+		// checking the floor before mutating the pool means a rejected
+		// transaction never costs an existing one its place.
+		victim, victimFeePerByte, evictable := tp.lowestFeeTransaction()
+		if !evictable {
+			return errPoolFull
+		}
+		if !highPriority && fpb.Cmp(victimFeePerByte) <= 0 {
+			return errPoolFull
+		}
+		// The eviction has to free enough room for t, or the pool would end
+		// up over MaxPoolSizeBytes.
+		freed := uint64(len(encoding.Marshal(victim)))
+		seen := make(map[types.TransactionID]struct{})
+		for _, descendant := range tp.descendantsOf(victim) {
+			if _, dup := seen[descendant.ID()]; dup {
+				continue
+			}
+			seen[descendant.ID()] = struct{}{}
+			freed += uint64(len(encoding.Marshal(descendant)))
+		}
+		if freed < tp.poolSizeBytes()+size-p.MaxPoolSizeBytes {
+			return errPoolFull
+		}
+		if err := tp.evictTransaction(victim); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
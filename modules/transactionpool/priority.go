@@ -0,0 +1,62 @@
+package transactionpool
+
+import (
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// hostAnnouncementPrefix tags the arbitrary data blobs recognized as host
+// announcements, mirroring the dataIndicator byte used by the legacy
+// sia.State transaction pool.
+var hostAnnouncementPrefix = types.Specifier{'H', 'o', 's', 't', 'A', 'n', 'n', 'o', 'u', 'n', 'c', 'e', 'm', 'e', 'n', 't'}
+
+// hostAnnouncement is the payload of a host announcement: the announcing
+// host freezes coins in one of the transaction's own outputs until the
+// output's timelock expires, exactly as the legacy sia.State host
+// announcement scheme does with its SpendConditions/FreezeIndex pair.
+type hostAnnouncement struct {
+	UnlockHash  types.UnlockHash
+	FreezeIndex uint64
+}
+
+// isHighPriorityHostAnnouncement reports whether arbitraryData decodes into
+// a well-formed host announcement whose freeze output is actually present
+// in t and pays to the announced unlock hash.
+func isHighPriorityHostAnnouncement(t types.Transaction, arbitraryData []byte) bool {
+	if len(arbitraryData) <= len(hostAnnouncementPrefix) {
+		return false
+	}
+	var prefix types.Specifier
+	copy(prefix[:], arbitraryData[:len(hostAnnouncementPrefix)])
+	if prefix != hostAnnouncementPrefix {
+		return false
+	}
+
+	var ha hostAnnouncement
+	if err := encoding.Unmarshal(arbitraryData[len(hostAnnouncementPrefix):], &ha); err != nil {
+		return false
+	}
+	if ha.FreezeIndex >= uint64(len(t.SiacoinOutputs)) {
+		return false
+	}
+	return t.SiacoinOutputs[ha.FreezeIndex].UnlockHash == ha.UnlockHash
+}
+
+// isHighPriority reports whether t qualifies for high-priority treatment: it
+// contains a storage proof against a contract whose proof window is
+// currently open, or a well-formed host announcement. High-priority
+// transactions bypass the policy's fee-per-byte minimums, are packed first
+// by the miner, and cannot be evicted by replace-by-fee.
+func (tp *TransactionPool) isHighPriority(t types.Transaction) bool {
+	for _, sp := range t.StorageProofs {
+		if tp.cs.StorageProofWindowOpen(sp.ParentID) {
+			return true
+		}
+	}
+	for _, arbitraryData := range t.ArbitraryData {
+		if isHighPriorityHostAnnouncement(t, arbitraryData) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,172 @@
+package transactionpool
+
+import (
+	"errors"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+const (
+	// maxRBFDisplacedTransactions bounds how many existing pool
+	// transactions a single replace-by-fee may evict at once.
+	maxRBFDisplacedTransactions = 25
+)
+
+// MinRBFBumpFeePerByte is the minimum amount, in Hastings per byte of the
+// replacement transaction's encoded size, that a replacement must pay over
+// the combined fees of everything it displaces. This mirrors BIP-125's
+// incremental relay fee requirement.
+var MinRBFBumpFeePerByte = types.NewCurrency64(1)
+
+var (
+	errTooManyDisplaced     = errors.New("replacement transaction would displace too many transactions")
+	errInsufficientBump     = errors.New("replacement transaction does not pay enough fee to displace the transactions it conflicts with")
+	errNewDependency        = errors.New("replacement transaction depends on another transaction in the pool")
+	errHighPriorityConflict = errors.New("cannot use replace-by-fee to displace a high-priority transaction")
+)
+
+// TransactionReplaced is delivered to ReplacementSubscribers whenever a
+// replace-by-fee evicts old to make room for new.
+type TransactionReplaced struct {
+	Old types.Transaction
+	New types.Transaction
+}
+
+// ReplacementSubscriber is implemented by tpool subscribers, such as the
+// wallet and miner, that need to react to a transaction being displaced by
+// replace-by-fee rather than simply confirmed.
+type ReplacementSubscriber interface {
+	ReceiveTransactionReplaced(TransactionReplaced)
+}
+
+// acceptReplacement attempts to admit t in place of the conflicting pool
+// transactions it was submitted alongside. High-priority conflicts can
+// never be displaced. The caller must hold tp.mu.
+func (tp *TransactionPool) acceptReplacement(t types.Transaction, conflicts []types.Transaction, highPriority bool) error {
+	if len(conflicts) > maxRBFDisplacedTransactions {
+		return errTooManyDisplaced
+	}
+
+	displacedIDs := make(map[types.TransactionID]struct{})
+	for _, conflict := range conflicts {
+		if _, protected := tp.highPriorityIDs[conflict.ID()]; protected {
+			return errHighPriorityConflict
+		}
+		displacedIDs[conflict.ID()] = struct{}{}
+	}
+
+	// The replacement may not introduce a new unconfirmed dependency of its
+	// own: spending an output created by a pool transaction that isn't
+	// being displaced would leave the replacement dangling on a
+	// transaction it never conflicted with, so bound how much work a
+	// single replacement can trigger. A transaction spending an output
+	// created by one of the conflicts being displaced is not a new
+	// dependency, since that conflict is being removed anyway. Neither is an
+	// unconfirmed output that one of the conflicts already spends.
+	spentByConflicts := make(map[types.SiacoinOutputID]struct{})
+	for _, conflict := range conflicts {
+		for _, input := range conflict.SiacoinInputs {
+			spentByConflicts[input.ParentID] = struct{}{}
+		}
+	}
+	produced := make(map[types.SiacoinOutputID]struct{})
+	for _, candidate := range tp.transactionList {
+		if _, displaced := displacedIDs[candidate.ID()]; displaced {
+			continue
+		}
+		for i := range candidate.SiacoinOutputs {
+			produced[candidate.SiacoinOutputID(uint64(i))] = struct{}{}
+		}
+	}
+	for _, input := range t.SiacoinInputs {
+		if _, shared := spentByConflicts[input.ParentID]; shared {
+			continue
+		}
+		if _, dependency := produced[input.ParentID]; dependency {
+			return errNewDependency
+		}
+	}
+
+	if err := tp.validTransaction(t); err != nil {
+		return err
+	}
+
+	// A replacement is held to the same policy as any other transaction:
+	// conflicting with the pool is not a way around BlockedUnlockHashes,
+	// the size caps, or the sender limit.
+	if err := tp.checkPolicy(t, highPriority, true); err != nil {
+		return err
+	}
+
+	displacedFees := types.ZeroCurrency
+	for _, conflict := range conflicts {
+		for _, fee := range conflict.MinerFees {
+			displacedFees = displacedFees.Add(fee)
+		}
+	}
+
+	newFees := types.ZeroCurrency
+	for _, fee := range t.MinerFees {
+		newFees = newFees.Add(fee)
+	}
+
+	size := types.NewCurrency64(uint64(len(encoding.Marshal(t))))
+	requiredFees := displacedFees.Add(MinRBFBumpFeePerByte.Mul(size))
+	if newFees.Cmp(requiredFees) < 0 {
+		return errInsufficientBump
+	}
+
+	// A replacement is held to the same policy as any other transaction:
+	// conflicting with the pool is not a way around BlockedUnlockHashes,
+	// the size caps, or the sender limit. The policy is checked a second
+	// time here, after the fee bump has been checked; the first check above
+	// may already have evicted a transaction.
+	if err := tp.checkPolicy(t, highPriority, true); err != nil {
+		return err
+	}
+
+	for _, conflict := range conflicts {
+		tp.logAndRemoveTransaction(conflict)
+	}
+
+	if err := tp.logAndAddTransaction(t, highPriority); err != nil {
+		return err
+	}
+	tp.notifyReplacements(conflicts, t)
+	tp.notifySubscribers()
+	tp.gateway.Broadcast("RelayTransaction", t)
+
+	return nil
+}
+
+// notifyReplacements informs every ReplacementSubscriber of the
+// transactions that t displaced. The caller must hold tp.mu.
+func (tp *TransactionPool) notifyReplacements(displaced []types.Transaction, replacement types.Transaction) {
+	for _, subscriber := range tp.subscribers {
+		rs, ok := subscriber.(ReplacementSubscriber)
+		if !ok {
+			continue
+		}
+		for _, old := range displaced {
+			rs.ReceiveTransactionReplaced(TransactionReplaced{Old: old, New: replacement})
+		}
+	}
+}
+
+// PurgeTransaction removes the transaction with the given id from the pool,
+// if present, and notifies subscribers of the new transaction set. It is
+// used to drop transactions that have expired or otherwise become
+// unwanted without waiting for them to conflict with something else.
+func (tp *TransactionPool) PurgeTransaction(id types.TransactionID) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	for _, t := range tp.transactionList {
+		if t.ID() == id {
+			tp.logAndRemoveTransaction(t)
+			tp.notifySubscribers()
+			return
+		}
+	}
+}
@@ -0,0 +1,201 @@
+// Package transactionpool tracks a set of unconfirmed transactions that have
+// not yet appeared in a block. It is responsible for validating transactions
+// before they are relayed to the rest of the network and before they are
+// handed to the miner for inclusion in a block.
+package transactionpool
+
+import (
+	"errors"
+	"os"
+	"sync"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+var (
+	errNilConsensusSet = errors.New("transaction pool cannot use a nil consensus set")
+	errNilGateway      = errors.New("transaction pool cannot use a nil gateway")
+)
+
+// TransactionPool holds the unconfirmed transaction set and everything
+// needed to validate new transactions against it. A transaction is indexed
+// in transactions under the id of every output its inputs spend, matching
+// the scheme used historically by the legacy sia.State transaction pool.
+type TransactionPool struct {
+	cs      modules.ConsensusSet
+	gateway modules.Gateway
+
+	transactions    map[types.SiacoinOutputID]types.Transaction
+	transactionList []types.Transaction
+
+	// highPriorityIDs tracks which pool transactions are high-priority
+	// (storage proofs and host announcements): they bypass the policy's fee
+	// minimums and can never be chosen as an eviction or RBF victim.
+	highPriorityIDs map[types.TransactionID]struct{}
+
+	// policy gates which transactions are allowed into the pool and decides
+	// what gets evicted when the pool is full.
+	policy Policy
+
+	persistDir  string
+	subscribers []modules.TransactionPoolSubscriber
+
+	// wal and walSeq back the on-disk write-ahead log that lets the pool
+	// survive a restart without losing its unconfirmed transactions.
+	wal       *os.File
+	walSeq    uint64
+	txnMeta   map[types.TransactionID]*txnMeta
+	closeChan chan struct{}
+
+	mu sync.RWMutex
+}
+
+// New creates a transaction pool that is ready to receive transactions.
+func New(cs modules.ConsensusSet, g modules.Gateway, persistDir string) (*TransactionPool, error) {
+	if cs == nil {
+		return nil, errNilConsensusSet
+	}
+	if g == nil {
+		return nil, errNilGateway
+	}
+
+	tp := &TransactionPool{
+		cs:      cs,
+		gateway: g,
+
+		transactions:    make(map[types.SiacoinOutputID]types.Transaction),
+		highPriorityIDs: make(map[types.TransactionID]struct{}),
+		txnMeta:         make(map[types.TransactionID]*txnMeta),
+		closeChan:       make(chan struct{}),
+
+		policy: DefaultPolicy(),
+
+		persistDir: persistDir,
+	}
+
+	if err := tp.initPersist(); err != nil {
+		return nil, err
+	}
+	if err := tp.initWAL(); err != nil {
+		return nil, err
+	}
+
+	cs.ConsensusSetSubscribe(tp)
+	go tp.threadedRebroadcast()
+
+	return tp, nil
+}
+
+// addTransactionToPool adds a transaction to the pool and transaction list
+// without performing any validation. The caller must hold tp.mu.
+func (tp *TransactionPool) addTransactionToPool(t types.Transaction, highPriority bool) {
+	for _, input := range t.SiacoinInputs {
+		tp.transactions[input.ParentID] = t
+	}
+	tp.transactionList = append(tp.transactionList, t)
+	if highPriority {
+		tp.highPriorityIDs[t.ID()] = struct{}{}
+	}
+}
+
+// removeTransactionFromPool takes a transaction out of the pool and
+// transaction list. The caller must hold tp.mu.
+func (tp *TransactionPool) removeTransactionFromPool(t types.Transaction) {
+	for _, input := range t.SiacoinInputs {
+		delete(tp.transactions, input.ParentID)
+	}
+	delete(tp.highPriorityIDs, t.ID())
+	for i, txn := range tp.transactionList {
+		if txn.ID() == t.ID() {
+			tp.transactionList = append(tp.transactionList[:i], tp.transactionList[i+1:]...)
+			break
+		}
+	}
+}
+
+// conflictingTransactions returns the set of pool transactions that share an
+// input with t.
+func (tp *TransactionPool) conflictingTransactions(t types.Transaction) []types.Transaction {
+	seen := make(map[types.TransactionID]struct{})
+	var conflicts []types.Transaction
+	for _, input := range t.SiacoinInputs {
+		conflict, exists := tp.transactions[input.ParentID]
+		if !exists {
+			continue
+		}
+		if _, alreadySeen := seen[conflict.ID()]; alreadySeen {
+			continue
+		}
+		seen[conflict.ID()] = struct{}{}
+		conflicts = append(conflicts, conflict)
+	}
+	return conflicts
+}
+
+// validTransaction returns an error if the transaction is not valid given
+// the current consensus set.
+func (tp *TransactionPool) validTransaction(t types.Transaction) error {
+	return tp.cs.ValidTransaction(t)
+}
+
+// AcceptTransaction adds a transaction to the unconfirmed set of
+// transactions. It is thread safe and can be called concurrently.
+func (tp *TransactionPool) AcceptTransaction(t types.Transaction) error {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	highPriority := tp.isHighPriority(t)
+
+	// A conflict with the pool is only rejected outright if it can't be
+	// resolved by replace-by-fee.
+	if conflicts := tp.conflictingTransactions(t); len(conflicts) > 0 {
+		return tp.acceptReplacement(t, conflicts, highPriority)
+	}
+
+	if err := tp.validTransaction(t); err != nil {
+		return err
+	}
+
+	if err := tp.checkPolicy(t, highPriority, true); err != nil {
+		return err
+	}
+
+	if err := tp.logAndAddTransaction(t, highPriority); err != nil {
+		return err
+	}
+	tp.notifySubscribers()
+	tp.gateway.Broadcast("RelayTransaction", t)
+
+	return nil
+}
+
+// TransactionSet returns the current set of unconfirmed transactions.
+func (tp *TransactionPool) TransactionSet() []types.Transaction {
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+
+	set := make([]types.Transaction, len(tp.transactionList))
+	copy(set, tp.transactionList)
+	return set
+}
+
+// TransactionPoolSubscribe adds a subscriber to the transaction pool.
+// The subscriber will receive the full transaction set immediately, and
+// a new transaction set each time the transaction pool's unconfirmed
+// transactions change.
+func (tp *TransactionPool) TransactionPoolSubscribe(subscriber modules.TransactionPoolSubscriber) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	tp.subscribers = append(tp.subscribers, subscriber)
+	subscriber.ReceiveUpdatedUnconfirmedTransactions(tp.transactionList, modules.ConsensusChange{})
+}
+
+// notifySubscribers informs all subscribers of the current transaction set.
+// The caller must hold tp.mu.
+func (tp *TransactionPool) notifySubscribers() {
+	for _, subscriber := range tp.subscribers {
+		subscriber.ReceiveUpdatedUnconfirmedTransactions(tp.transactionList, modules.ConsensusChange{})
+	}
+}
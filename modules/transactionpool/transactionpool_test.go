@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/modules/consensus"
 	"github.com/NebulousLabs/Sia/modules/gateway"
@@ -103,7 +104,7 @@ func newTpoolTester(name string, t *testing.T) *tpoolTester {
 	}
 
 	// Create the transaction pool.
-	tp, err := New(cs, g)
+	tp, err := New(cs, g, filepath.Join(testdir, modules.TransactionPoolDir))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -156,7 +157,217 @@ func TestNewNilInputs(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	New(nil, nil)
-	New(cs, nil)
-	New(nil, g)
+	New(nil, nil, testdir)
+	New(cs, nil, testdir)
+	New(nil, g, testdir)
+}
+
+// TestPolicyMaxPoolSizeEvicts checks that once the pool reaches its
+// configured size cap, the lowest fee-per-byte transaction is evicted to
+// make room for a new, higher-paying transaction.
+func TestPolicyMaxPoolSizeEvicts(t *testing.T) {
+	tpt := newTpoolTester("TestPolicyMaxPoolSizeEvicts", t)
+
+	lowFee, err := tpt.sendCoins(types.NewCurrency64(1), types.UnlockConditions{}.UnlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lowSize := uint64(len(encoding.Marshal(lowFee)))
+
+	// Shrink the pool so that the low-fee transaction alone fills it, then
+	// submit a second, better paying transaction that has to evict it.
+	err = tpt.tpool.SetPolicy(Policy{
+		MaxPoolSizeBytes:            lowSize,
+		MaxTransactionSizeBytes:     1e6,
+		MinFeePerByte:               types.NewCurrency64(0),
+		MaxFreeTransactionSizeBytes: 1e6,
+		MaxTransactionsPerSender:    1e6,
+		BlockedUnlockHashes:         make(map[types.UnlockHash]struct{}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	highFee, err := tpt.sendCoins(types.NewCurrency64(100), types.UnlockConditions{}.UnlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set := tpt.tpool.TransactionSet()
+	foundHigh := false
+	for _, txn := range set {
+		if txn.ID() == highFee.ID() {
+			foundHigh = true
+		}
+		if txn.ID() == lowFee.ID() {
+			t.Fatal("low fee transaction was not evicted")
+		}
+	}
+	if !foundHigh {
+		t.Fatal("high fee transaction was not admitted")
+	}
+}
+
+// TestPolicyBlockedUnlockHash checks that a transaction paying to a blocked
+// address is rejected.
+func TestPolicyBlockedUnlockHash(t *testing.T) {
+	tpt := newTpoolTester("TestPolicyBlockedUnlockHash", t)
+
+	dest := types.UnlockConditions{}.UnlockHash()
+	p := DefaultPolicy()
+	p.BlockedUnlockHashes[dest] = struct{}{}
+	if err := tpt.tpool.SetPolicy(p); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := tpt.sendCoins(types.NewCurrency64(1), dest)
+	if err != errBlockedAddress {
+		t.Fatalf("expected errBlockedAddress, got %v", err)
+	}
+}
+
+// TestPolicyMinFeePerByte checks that a transaction paying less than the
+// configured minimum fee per byte is rejected.
+func TestPolicyMinFeePerByte(t *testing.T) {
+	tpt := newTpoolTester("TestPolicyMinFeePerByte", t)
+
+	p := DefaultPolicy()
+	p.MaxFreeTransactionSizeBytes = 0
+	p.MinFeePerByte = types.NewCurrency64(1e12)
+	if err := tpt.tpool.SetPolicy(p); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := tpt.sendCoins(types.NewCurrency64(1), types.UnlockConditions{}.UnlockHash())
+	if err != errFeeTooLow {
+		t.Fatalf("expected errFeeTooLow, got %v", err)
+	}
+}
+
+// TestHighPriorityHostAnnouncementBypassesMinFee checks that a host
+// announcement is admitted even when it pays less than the policy's
+// minimum fee per byte.
+func TestHighPriorityHostAnnouncementBypassesMinFee(t *testing.T) {
+	tpt := newTpoolTester("TestHighPriorityHostAnnouncementBypassesMinFee", t)
+
+	// Fund the announcement under the default policy, before the
+	// restrictive policy below makes ordinary zero-fee transactions
+	// unfundable.
+	dest := types.UnlockConditions{}.UnlockHash()
+	txn, err := tpt.sendCoins(types.NewCurrency64(1), dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputID := txn.SiacoinOutputID(0)
+
+	p := DefaultPolicy()
+	p.MaxFreeTransactionSizeBytes = 0
+	p.MinFeePerByte = types.NewCurrency64(1e12)
+	if err := tpt.tpool.SetPolicy(p); err != nil {
+		t.Fatal(err)
+	}
+
+	ha := hostAnnouncement{UnlockHash: dest, FreezeIndex: 0}
+	announcement := types.Transaction{
+		SiacoinInputs: []types.SiacoinInput{
+			{ParentID: outputID},
+		},
+		SiacoinOutputs: []types.SiacoinOutput{
+			{Value: types.NewCurrency64(1), UnlockHash: dest},
+		},
+		ArbitraryData: [][]byte{append(hostAnnouncementPrefix[:], encoding.Marshal(ha)...)},
+	}
+
+	if err := tpt.tpool.AcceptTransaction(announcement); err != nil {
+		t.Fatalf("high-priority host announcement should bypass the min fee policy: %v", err)
+	}
+}
+
+// TestReplaceByFeeSucceeds checks that a transaction conflicting with a pool
+// transaction, but paying a sufficiently higher fee, displaces it via
+// replace-by-fee.
+func TestReplaceByFeeSucceeds(t *testing.T) {
+	tpt := newTpoolTester("TestReplaceByFeeSucceeds", t)
+
+	dest := types.UnlockConditions{}.UnlockHash()
+	funding, err := tpt.sendCoins(types.NewCurrency64(1e6), dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputID := funding.SiacoinOutputID(0)
+
+	original := types.Transaction{
+		SiacoinInputs: []types.SiacoinInput{
+			{ParentID: outputID},
+		},
+		SiacoinOutputs: []types.SiacoinOutput{
+			{Value: types.NewCurrency64(999000), UnlockHash: dest},
+		},
+		MinerFees: []types.Currency{types.NewCurrency64(1000)},
+	}
+	if err := tpt.tpool.AcceptTransaction(original); err != nil {
+		t.Fatal(err)
+	}
+
+	// Replace it with a conflicting transaction that pays a much higher
+	// fee, comfortably clearing MinRBFBumpFeePerByte for any reasonable
+	// encoded size.
+	replacement := types.Transaction{
+		SiacoinInputs: []types.SiacoinInput{
+			{ParentID: outputID},
+		},
+		SiacoinOutputs: []types.SiacoinOutput{
+			{Value: types.NewCurrency64(900000), UnlockHash: dest},
+		},
+		MinerFees: []types.Currency{types.NewCurrency64(100000)},
+	}
+	if err := tpt.tpool.AcceptTransaction(replacement); err != nil {
+		t.Fatalf("replacement transaction should have displaced the original: %v", err)
+	}
+
+	set := tpt.tpool.TransactionSet()
+	foundReplacement := false
+	for _, txn := range set {
+		if txn.ID() == original.ID() {
+			t.Fatal("original transaction was not displaced by replace-by-fee")
+		}
+		if txn.ID() == replacement.ID() {
+			foundReplacement = true
+		}
+	}
+	if !foundReplacement {
+		t.Fatal("replacement transaction was not admitted")
+	}
+}
+
+// TestWALCrashRecovery checks that an unconfirmed transaction survives the
+// transaction pool being closed and recreated against the same persist
+// directory.
+func TestWALCrashRecovery(t *testing.T) {
+	tpt := newTpoolTester("TestWALCrashRecovery", t)
+
+	txn, err := tpt.sendCoins(types.NewCurrency64(1), types.UnlockConditions{}.UnlockHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tpt.tpool.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tp2, err := New(tpt.cs, tpt.gateway, tpt.tpool.persistDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tp2.Close()
+
+	found := false
+	for _, survivor := range tp2.TransactionSet() {
+		if survivor.ID() == txn.ID() {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("transaction did not survive a transaction pool restart")
+	}
 }
@@ -0,0 +1,32 @@
+package transactionpool
+
+import (
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// ReceiveConsensusSetUpdate removes every transaction that was confirmed in
+// cc.AppliedBlocks from the unconfirmed set, and re-adds any transaction
+// from a reverted block whose inputs are still unspent. This is part of the
+// modules.ConsensusSetSubscriber interface.
+func (tp *TransactionPool) ReceiveConsensusSetUpdate(cc modules.ConsensusChange) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	for _, block := range cc.AppliedBlocks {
+		for _, t := range block.Transactions {
+			if _, exists := tp.txnMeta[t.ID()]; exists {
+				tp.logAndRemoveTransaction(t)
+			}
+		}
+	}
+
+	for _, block := range cc.RevertedBlocks {
+		for _, t := range block.Transactions {
+			if err := tp.validTransaction(t); err == nil {
+				tp.logAndAddTransaction(t, tp.isHighPriority(t))
+			}
+		}
+	}
+
+	tp.notifySubscribers()
+}
@@ -0,0 +1,32 @@
+package sia
+
+import "github.com/NebulousLabs/Andromeda/encoding"
+
+// isHighPriorityTransaction reports whether t contains a storage proof
+// against an open contract whose proof window has not yet been satisfied,
+// or a well-formed host announcement. High-priority transactions can never
+// be displaced from the pool by a replace-by-fee transaction.
+func (s *State) isHighPriorityTransaction(t Transaction) bool {
+	for _, sp := range t.StorageProofs {
+		openContract, exists := s.OpenContracts[sp.ContractID]
+		if !exists || openContract.WindowSatisfied {
+			continue
+		}
+		if s.Height() >= openContract.FileContract.Start && s.Height() < openContract.FileContract.End {
+			return true
+		}
+	}
+
+	if len(t.ArbitraryData) > 8 {
+		dataIndicator := encoding.DecUint64(t.ArbitraryData[0:8])
+		if dataIndicator == 1 {
+			var ha HostAnnouncement
+			encoding.Unmarshal(t.ArbitraryData[1:], &ha)
+			if int(ha.FreezeIndex) < len(t.Outputs) && ha.SpendConditions.CoinAddress() == t.Outputs[ha.FreezeIndex].SpendHash {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -268,22 +268,130 @@ func (s *State) validTransaction(t *Transaction) (err error) {
 	return
 }
 
+// MinRBFBumpFeePerByte is the minimum amount, in Hastings per byte of the
+// replacement transaction's encoded size, that a replace-by-fee transaction
+// must pay over the combined fees of everything it displaces.
+var MinRBFBumpFeePerByte = Currency(1)
+
+// maxRBFDisplacedTransactions bounds how many existing pool transactions a
+// single replace-by-fee may evict at once.
+const maxRBFDisplacedTransactions = 25
+
+// conflictingPoolTransactions returns the distinct transaction pool entries
+// that share an input with t.
+func (s *State) conflictingPoolTransactions(t Transaction) (conflicts []*Transaction) {
+	seen := make(map[*Transaction]struct{})
+	for _, input := range t.Inputs {
+		conflict, exists := s.TransactionPool[input.OutputID]
+		if !exists {
+			continue
+		}
+		if _, alreadySeen := seen[conflict]; alreadySeen {
+			continue
+		}
+		seen[conflict] = struct{}{}
+		conflicts = append(conflicts, conflict)
+	}
+	return
+}
+
+// acceptReplacementTransaction implements opt-in replace-by-fee: t is
+// admitted in place of the transactions it conflicts with if it pays at
+// least MinRBFBumpFeePerByte more, per byte, than the combined fees of
+// everything it would displace (BIP-125-style). This legacy pool has no
+// size, fee, or blocked-address policy of its own to enforce beyond
+// validTransaction, so unlike modules/transactionpool.acceptReplacement
+// there is no extra policy check to run here: a replacement is held to
+// exactly the same bar as any other transaction accepted through
+// State.AcceptTransaction.
+func (s *State) acceptReplacementTransaction(t Transaction, conflicts []*Transaction) (err error) {
+	if len(conflicts) > maxRBFDisplacedTransactions {
+		err = errors.New("replacement transaction would displace too many transactions")
+		return
+	}
+
+	displaced := make(map[*Transaction]struct{})
+	for _, conflict := range conflicts {
+		if s.isHighPriorityTransaction(*conflict) {
+			err = errors.New("cannot use replace-by-fee to displace a high-priority transaction")
+			return
+		}
+		displaced[conflict] = struct{}{}
+	}
+
+	// The replacement may not introduce a new unconfirmed dependency of its
+	// own: spending an output created by a pool transaction that isn't
+	// being displaced would leave the replacement dangling on a
+	// transaction it never conflicted with, so bound how much work a
+	// single replacement can trigger. A transaction spending an output
+	// created by one of the conflicts being displaced is not a new
+	// dependency, since that conflict is being removed anyway.
+	produced := make(map[OutputID]struct{})
+	for _, candidate := range s.TransactionList {
+		if _, isDisplaced := displaced[candidate]; isDisplaced {
+			continue
+		}
+		for i := range candidate.Outputs {
+			produced[candidate.OutputID(i)] = struct{}{}
+		}
+	}
+	for _, input := range t.Inputs {
+		if _, dependency := produced[input.OutputID]; dependency {
+			err = errors.New("replacement transaction depends on another transaction in the pool")
+			return
+		}
+	}
+
+	err = s.validTransaction(&t)
+	if err != nil {
+		return
+	}
+
+	displacedFees := Currency(0)
+	for _, conflict := range conflicts {
+		for _, fee := range conflict.MinerFees {
+			displacedFees += fee
+		}
+	}
+
+	newFees := Currency(0)
+	for _, fee := range t.MinerFees {
+		newFees += fee
+	}
+
+	size := Currency(len(encoding.Marshal(t)))
+	if newFees < displacedFees+MinRBFBumpFeePerByte*size {
+		err = errors.New("replacement transaction does not pay enough fee to displace the transactions it conflicts with")
+		return
+	}
+
+	for _, conflict := range conflicts {
+		s.removeTransactionFromPool(conflict)
+	}
+
+	s.addTransactionToPool(&t)
+	s.Server.Broadcast(SendVal('T', t))
+
+	return
+}
+
 // State.AcceptTransaction() checks for a conflict of the transaction with the
 // transaction pool, then checks that the transaction is valid given the
-// current state, then adds the transaction to the transaction pool.
-// AcceptTransaction() is thread safe, and can be called concurrently.
+// current state, then adds the transaction to the transaction pool. A
+// transaction that conflicts with the pool is not rejected outright if it
+// can replace the conflicting transactions via replace-by-fee; see
+// acceptReplacementTransaction. AcceptTransaction() is thread safe, and can
+// be called concurrently.
 func (s *State) AcceptTransaction(t Transaction) (err error) {
 	s.Lock()
 	defer s.Unlock()
 
-	// Check that the transaction is not in conflict with the transaction
-	// pool.
-	for _, input := range t.Inputs {
-		_, exists := s.TransactionPool[input.OutputID]
-		if exists {
-			err = errors.New("conflicting transaction exists in transaction pool")
-			return
-		}
+	// Check whether the transaction conflicts with the transaction pool; if
+	// it does, try to resolve the conflict with replace-by-fee instead of
+	// rejecting outright.
+	conflicts := s.conflictingPoolTransactions(t)
+	if len(conflicts) > 0 {
+		return s.acceptReplacementTransaction(t, conflicts)
 	}
 
 	// Check that the transaction is potentially valid.